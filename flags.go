@@ -0,0 +1,94 @@
+package prosemirror2html
+
+import "strings"
+
+// Flags is a bitmask of rendering options that influence how certain node and mark
+// types are rendered. The zero value renders as plainly as possible, matching the
+// behaviour of NewRenderer().
+type Flags int
+
+const (
+	// Safelink restricts 'link' mark hrefs to a protocol allow-list (http, https,
+	// mailto, tel, and relative/root-relative/fragment URLs). Links with an
+	// unrecognized protocol (e.g. "javascript:") are rendered without the
+	// surrounding <a> tag, same as SkipLinks.
+	Safelink Flags = 1 << iota
+	// NofollowLinks adds rel="nofollow" to rendered links, merging with any
+	// rel tokens already present on the link mark.
+	NofollowLinks
+	// NoreferrerLinks adds rel="noreferrer" to rendered links, merging with any
+	// rel tokens already present on the link mark.
+	NoreferrerLinks
+	// NoopenerLinks adds rel="noopener" to rendered links, merging with any
+	// rel tokens already present on the link mark.
+	NoopenerLinks
+	// HrefTargetBlank adds target="_blank" to rendered links, unless the link
+	// mark already specifies a target.
+	HrefTargetBlank
+	// SkipImages suppresses 'image' nodes entirely. Sibling and parent content
+	// is still rendered.
+	SkipImages
+	// SkipLinks renders the text of a 'link' mark without the surrounding <a> tag.
+	SkipLinks
+	// HeadingAnchors auto-generates a URL-safe slug id for every 'heading' node and
+	// renders it as an id="..." attribute on the <hN> tag, deduplicating collisions
+	// with "-2", "-3", ... suffixes. RenderWithTOC always generates these ids,
+	// regardless of this flag.
+	HeadingAnchors
+
+	// There is intentionally no SkipHTML flag: this renderer has no node type for
+	// raw/untrusted HTML (Prosemirror's schema would need a dedicated 'html' node
+	// type for that), so there is nothing for such a flag to suppress.
+)
+
+// allowedURISchemes lists the URI schemes (and scheme-less prefixes) considered
+// safe when Safelink is set, mirroring blackfriday's notion of a "safe" link.
+var allowedURISchemes = []string{
+	"http://",
+	"https://",
+	"mailto:",
+	"tel:",
+	"/",
+	"#",
+}
+
+// isSafeURL reports whether href uses an allow-listed protocol, is root-relative
+// or a fragment, or is a relative URL without a protocol at all.
+func isSafeURL(href string) bool {
+	// a leading "//" is a protocol-relative URL (e.g. "//evil.example.com/phish"), not a
+	// root-relative one, and must not be confused with the "/" entry in allowedURISchemes.
+	if strings.HasPrefix(href, "//") {
+		return false
+	}
+
+	for _, prefix := range allowedURISchemes {
+		if strings.HasPrefix(href, prefix) {
+			return true
+		}
+	}
+
+	// no ':' means no scheme, i.e. a plain relative URL like "page.html"
+	return !strings.Contains(href, ":")
+}
+
+// mergeTokens merges additional space-separated tokens into existing, a
+// space-separated attribute value such as "rel" or "class", without
+// duplicating any token already present.
+func mergeTokens(existing string, additional ...string) string {
+	tokens := strings.Fields(existing)
+
+	seen := make(map[string]bool, len(tokens))
+	for _, tok := range tokens {
+		seen[tok] = true
+	}
+
+	for _, tok := range additional {
+		if tok == "" || seen[tok] {
+			continue
+		}
+		tokens = append(tokens, tok)
+		seen[tok] = true
+	}
+
+	return strings.Join(tokens, " ")
+}
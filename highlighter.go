@@ -0,0 +1,14 @@
+package prosemirror2html
+
+// Highlighter syntax-highlights the text of a 'code_block' node. Implementations typically wrap
+// a highlighting library such as chroma or pygments. The returned htmlSnippet is inserted as-is
+// inside the rendered <code> element, so it must already be safe, escaped HTML.
+type Highlighter interface {
+	Highlight(code, lang string) (htmlSnippet string, err error)
+}
+
+// SetHighlighter registers a Highlighter used to render 'code_block' nodes. When unset,
+// code_block text is rendered as HTML-escaped plain text.
+func (r *Renderer) SetHighlighter(h Highlighter) {
+	r.highlighter = h
+}
@@ -1,48 +1,75 @@
 package prosemirror2html
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
-	"strings"
+	"io"
 )
 
 // Renderer holds the registered node and mark types.
 type Renderer struct {
-	nodes map[string][]Tag
-	marks map[string][]Tag
+	nodes       map[string][]Tag
+	marks       map[string][]Tag
+	flags       Flags
+	sanitizer   AttributeSanitizer
+	highlighter Highlighter
 }
 
 // NewRenderer returns a new Renderer, with the default node and mark types already registered.
 func NewRenderer() *Renderer {
-	return &Renderer{
-		nodes: map[string][]Tag{
-			"text":         {text{}},
-			"paragraph":    {SimpleTag{Name: "p"}},
-			"blockquote":   {SimpleTag{Name: "blockquote"}},
-			"bullet_list":  {SimpleTag{Name: "ul"}},
-			"heading":      {heading{}},
-			"hard_break":   {SimpleTag{Name: "br", SelfClosing: true}},
-			"image":        {SimpleTag{Name: "img", SelfClosing: true}},
-			"list_item":    {SimpleTag{Name: "li"}},
-			"ordered_list": {SimpleTag{Name: "ol"}},
-			"table":        {SimpleTag{Name: "table"}, SimpleTag{Name: "tbody"}},
-			"table_cell":   {SimpleTag{Name: "td"}},
-			"table_header": {SimpleTag{Name: "th"}},
-			"table_row":    {SimpleTag{Name: "tr"}},
-		},
-		marks: map[string][]Tag{
-			"link":        {SimpleTag{Name: "a"}},
-			"bold":        {SimpleTag{Name: "strong"}},
-			"code":        {SimpleTag{Name: "code"}},
-			"italic":      {SimpleTag{Name: "em"}},
-			"strike":      {SimpleTag{Name: "s"}},
-			"subscript":   {SimpleTag{Name: "sub"}},
-			"superscript": {SimpleTag{Name: "sup"}},
-			"underline":   {SimpleTag{Name: "u"}},
-		},
+	return NewRendererWithFlags(0)
+}
+
+// NewRendererWithFlags returns a new Renderer, with the default node and mark types already
+// registered, using flags to control safelisting of link hrefs, rel/target injection on links,
+// and suppression of images and links. See the Flags constants for details.
+func NewRendererWithFlags(flags Flags) *Renderer {
+	r := &Renderer{flags: flags}
+
+	r.nodes = map[string][]Tag{
+		"text":         {text{}},
+		"paragraph":    {SimpleTag{Name: "p", r: r, typ: "paragraph"}},
+		"blockquote":   {SimpleTag{Name: "blockquote", r: r, typ: "blockquote"}},
+		"bullet_list":  {SimpleTag{Name: "ul", r: r, typ: "bullet_list"}},
+		"code_block":   {codeBlock{r: r}},
+		"heading":      {heading{}},
+		"hard_break":   {SimpleTag{Name: "br", SelfClosing: true, r: r, typ: "hard_break"}},
+		"image":        {image{r: r}},
+		"list_item":    {SimpleTag{Name: "li", r: r, typ: "list_item"}},
+		"ordered_list": {orderedList{r: r}},
+		"table":        {SimpleTag{Name: "table", r: r, typ: "table"}, SimpleTag{Name: "tbody", r: r, typ: "table"}},
+		"table_cell":   {SimpleTag{Name: "td", r: r, typ: "table_cell"}},
+		"table_header": {SimpleTag{Name: "th", r: r, typ: "table_header"}},
+		"table_row":    {SimpleTag{Name: "tr", r: r, typ: "table_row"}},
 	}
+	r.marks = map[string][]Tag{
+		"link":        {link{r: r}},
+		"bold":        {SimpleTag{Name: "strong", r: r, typ: "bold"}},
+		"code":        {SimpleTag{Name: "code", r: r, typ: "code"}},
+		"italic":      {SimpleTag{Name: "em", r: r, typ: "italic"}},
+		"strike":      {SimpleTag{Name: "s", r: r, typ: "strike"}},
+		"subscript":   {SimpleTag{Name: "sub", r: r, typ: "subscript"}},
+		"superscript": {SimpleTag{Name: "sup", r: r, typ: "superscript"}},
+		"underline":   {SimpleTag{Name: "u", r: r, typ: "underline"}},
+	}
+
+	return r
+}
+
+// WithFlags sets r's Flags and returns r, so it can be chained onto NewRenderer().
+func (r *Renderer) WithFlags(flags Flags) *Renderer {
+	r.flags = flags
+	return r
+}
+
+// SetSanitizer registers an AttributeSanitizer that the default SimpleTag implementation
+// consults to filter node and mark attributes before rendering them as HTML. Pass nil (the
+// default) to render attributes as-is.
+func (r *Renderer) SetSanitizer(s AttributeSanitizer) {
+	r.sanitizer = s
 }
 
 // RegisterNode registers a custom node implementation.
@@ -63,26 +90,76 @@ func (r *Renderer) RegisterMark(typ string, tags ...Tag) { r.marks[typ] = tags }
 // Render parses a Prosemirror JSON document and renders the
 // contents using the nodes and mars registered with r.
 func (r *Renderer) Render(doc []byte) (string, error) {
+	buf := &bytes.Buffer{}
+
+	if err := r.RenderTo(buf, doc); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// RenderTo parses a Prosemirror JSON document and writes the rendered HTML to w,
+// using the nodes and marks registered with r. Unlike Render, RenderTo writes
+// directly to w instead of building up a string, which avoids allocating
+// intermediate string slices for large documents.
+func (r *Renderer) RenderTo(w io.Writer, doc []byte) error {
 	root, err := r.ParseNode(doc)
 	if err != nil {
-		return "", err
+		return err
 	}
 
 	if root.Type != "doc" {
-		return "", errors.New("not a document root node")
+		return errors.New("not a document root node")
 	}
 
-	html := []string{}
+	if r.flags&HeadingAnchors != 0 {
+		used := map[string]int{}
+		for _, n := range root.Content {
+			walkHeadings(n, used, nil)
+		}
+	}
 
 	for _, n := range root.Content {
-		rendered, err := r.RenderNode(n)
-		if err != nil {
-			return "", err
+		if err := r.RenderNodeTo(w, n); err != nil {
+			return err
 		}
-		html = append(html, rendered)
 	}
 
-	return strings.Join(html, ""), nil
+	return nil
+}
+
+// RenderWithTOC parses a Prosemirror JSON document and renders it like Render, additionally
+// returning a nested "<nav><ul>...</ul></nav>" table of contents built from the document's
+// headings, in document order. Every heading is given a deduplicated slug id, which the returned
+// bodyHTML's <hN> tags carry as id="..." and the TOC's <a href="#..."> entries point at; this
+// happens regardless of whether the HeadingAnchors flag is set. Non-monotonic level jumps (e.g.
+// h1 followed directly by h3) are bridged with empty intermediate <li> wrappers so the TOC stays
+// well-formed.
+func (r *Renderer) RenderWithTOC(doc []byte) (bodyHTML string, tocHTML string, err error) {
+	root, err := r.ParseNode(doc)
+	if err != nil {
+		return "", "", err
+	}
+
+	if root.Type != "doc" {
+		return "", "", errors.New("not a document root node")
+	}
+
+	used := map[string]int{}
+	entries := []tocEntry{}
+	for _, n := range root.Content {
+		walkHeadings(n, used, &entries)
+	}
+
+	buf := &bytes.Buffer{}
+	for _, n := range root.Content {
+		if err := r.RenderNodeTo(buf, n); err != nil {
+			return "", "", err
+		}
+	}
+
+	return buf.String(), buildTOC(entries), nil
 }
 
 // ParseNode parses the given Prosemirror JSON to a Node that can be rendered.
@@ -102,57 +179,71 @@ func (r *Renderer) ParseNode(data []byte) (*Node, error) {
 // RenderNode renders a nodes content children nodes, if any is given. When no
 // content children nodes are found, it renders the nodes text property.
 func (r *Renderer) RenderNode(n *Node) (string, error) {
-	html := []string{}
+	buf := &bytes.Buffer{}
 
+	if err := r.RenderNodeTo(buf, n); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// RenderNodeTo writes the given node as HTML to w.
+// RenderNodeTo returns an error when an unknown mark or node is encountered.
+// RenderNodeTo renders a nodes content children nodes, if any is given. When no
+// content children nodes are found, it renders the nodes text property.
+func (r *Renderer) RenderNodeTo(w io.Writer, n *Node) error {
 	// render opening tags of surrounding marks
 	for _, m := range n.Marks {
 		tags := r.marks[m.Type]
 		if tags == nil {
-			return "", fmt.Errorf("unknown mark '%s'", m.Type)
+			return fmt.Errorf("unknown mark '%s'", m.Type)
 		}
 		for _, t := range tags {
-			openTag, err := t.RenderOpening(m.Attrs)
-			if err != nil {
-				return "", fmt.Errorf("prosemirror2html: %w", err)
+			if err := asWriterTag(t).RenderOpeningTo(w, m.Attrs); err != nil {
+				return fmt.Errorf("prosemirror2html: %w", err)
 			}
-			html = append(html, openTag)
 		}
 	}
 
 	// render opening tag(s) of node
 	tags, ok := r.nodes[n.Type]
 	if !ok {
-		return "", fmt.Errorf("unknown node '%s'", n.Type)
+		return fmt.Errorf("unknown node '%s'", n.Type)
 	}
 	for _, t := range tags {
-		openTag, err := t.RenderOpening(n.Attrs)
-		if err != nil {
-			return "", fmt.Errorf("prosemirror2html: %w", err)
+		if err := asWriterTag(t).RenderOpeningTo(w, n.Attrs); err != nil {
+			return fmt.Errorf("prosemirror2html: %w", err)
 		}
-		html = append(html, openTag)
 	}
 
-	// render children nodes OR text
-	if len(n.Content) > 0 {
+	// render children nodes OR text, unless the node type wants to render its own text (e.g.
+	// code_block running a Highlighter), in which case that takes over regardless of whether
+	// the node's text lives in n.Text directly or in child text nodes, per Prosemirror's
+	// "content": "text*" schemas.
+	if tr, ok := tags[len(tags)-1].(TextRenderer); ok {
+		rendered, err := tr.RenderText(n.Attrs, extractText(n))
+		if err != nil {
+			return fmt.Errorf("prosemirror2html: %w", err)
+		}
+		if _, err := io.WriteString(w, rendered); err != nil {
+			return err
+		}
+	} else if len(n.Content) > 0 {
 		for _, child := range n.Content {
-			rendered, err := r.RenderNode(child)
-			if err != nil {
-				return "", err
+			if err := r.RenderNodeTo(w, child); err != nil {
+				return err
 			}
-			html = append(html, rendered)
 		}
-	} else {
-		html = append(html, template.HTMLEscapeString(n.Text))
+	} else if _, err := io.WriteString(w, template.HTMLEscapeString(n.Text)); err != nil {
+		return err
 	}
 
 	// render closing tag(s) of node
 	for i := len(tags) - 1; i >= 0; i-- {
-		t := tags[i]
-		closeTag, err := t.RenderClosing(n.Attrs)
-		if err != nil {
-			return "", fmt.Errorf("prosemirror2html: %w", err)
+		if err := asWriterTag(tags[i]).RenderClosingTo(w, n.Attrs); err != nil {
+			return fmt.Errorf("prosemirror2html: %w", err)
 		}
-		html = append(html, closeTag)
 	}
 
 	// render closing tags of surrounding marks
@@ -160,16 +251,14 @@ func (r *Renderer) RenderNode(n *Node) (string, error) {
 		m := n.Marks[i]
 		tags := r.marks[m.Type]
 		if tags == nil {
-			return "", fmt.Errorf("unknown mark '%s'", m.Type)
+			return fmt.Errorf("unknown mark '%s'", m.Type)
 		}
-		for _, t := range tags {
-			closeTag, err := t.RenderClosing(m.Attrs)
-			if err != nil {
-				return "", fmt.Errorf("prosemirror2html: %w", err)
+		for j := len(tags) - 1; j >= 0; j-- {
+			if err := asWriterTag(tags[j]).RenderClosingTo(w, m.Attrs); err != nil {
+				return fmt.Errorf("prosemirror2html: %w", err)
 			}
-			html = append(html, closeTag)
 		}
 	}
 
-	return strings.Join(html, ""), nil
+	return nil
 }
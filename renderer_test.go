@@ -1,6 +1,7 @@
 package prosemirror2html
 
 import (
+	"bytes"
 	"strings"
 	"testing"
 
@@ -39,47 +40,198 @@ func TestRenderer(t *testing.T) {
 		},
 		{
 			input:    `{"type":"doc","content":[{"type":"heading","attrs":{"level":2},"content":[{"type":"text","text":"Example Heading"}]},{"type":"paragraph","content":[{"type":"text","text":"You can "},{"type":"text","marks":[{"type":"code"}],"text":"write code"},{"type":"text","text":"."}]},{"type":"paragraph","content":[{"type":"text","text":"There are lots of formatting options, like "},{"type":"text","marks":[{"type":"bold"}],"text":"bold"},{"type":"text","text":", "},{"type":"text","marks":[{"type":"italic"}],"text":"italics"},{"type":"text","text":", "},{"type":"text","marks":[{"type":"underline"}],"text":"underline"},{"type":"text","text":", and "},{"type":"text","marks":[{"type":"strike"}],"text":"strikethrough"},{"type":"text","text":"."}]},{"type":"bullet_list","content":[{"type":"list_item","content":[{"type":"paragraph","content":[{"type":"text","text":"there are"}]}]},{"type":"list_item","content":[{"type":"paragraph","content":[{"type":"text","text":"bullet lists"}]}]}]},{"type":"paragraph","content":[{"type":"text","text":"as well as"}]},{"type":"ordered_list","attrs":{"order":1},"content":[{"type":"list_item","content":[{"type":"paragraph","content":[{"type":"text","text":"ordered"}]}]},{"type":"list_item","content":[{"type":"paragraph","content":[{"type":"text","text":"lists"}]}]}]},{"type":"blockquote","content":[{"type":"paragraph","content":[{"type":"text","text":"You can also make blockquotes"}]}]}]  }`,
-			expected: `<h2>Example Heading</h2><p>You can <code>write code</code>.</p><p>There are lots of formatting options, like <strong>bold</strong>, <em>italics</em>, <u>underline</u>, and <s>strikethrough</s>.</p><ul><li><p>there are</p></li><li><p>bullet lists</p></li></ul><p>as well as</p><ol order=1><li><p>ordered</p></li><li><p>lists</p></li></ol><blockquote><p>You can also make blockquotes</p></blockquote>`,
+			expected: `<h2>Example Heading</h2><p>You can <code>write code</code>.</p><p>There are lots of formatting options, like <strong>bold</strong>, <em>italics</em>, <u>underline</u>, and <s>strikethrough</s>.</p><ul><li><p>there are</p></li><li><p>bullet lists</p></li></ul><p>as well as</p><ol start="1"><li><p>ordered</p></li><li><p>lists</p></li></ol><blockquote><p>You can also make blockquotes</p></blockquote>`,
 		},
 	}
 
 	r := NewRenderer()
 
 	for _, c := range testcases {
-		expectedNodes, err := html.ParseFragment(strings.NewReader(c.expected), &html.Node{
-			Type:     html.ElementNode,
-			Data:     "body",
-			DataAtom: atom.Body,
-		})
-		if err != nil {
-			t.Fatal("could not parse expected HTML:", c.expected)
-		}
+		assertRendersAs(t, r, c.input, c.expected)
+	}
+}
 
-		output, err := r.Render([]byte(c.input))
-		if err != nil {
-			t.Fatal(err)
-		}
+// assertRendersAs renders input with r and fails t if the result isn't structurally equal to
+// expected, comparing parsed HTML fragments rather than raw strings so e.g. attribute order
+// doesn't matter.
+func assertRendersAs(t *testing.T, r *Renderer, input, expected string) {
+	t.Helper()
 
-		outputNodes, err := html.ParseFragment(strings.NewReader(output), &html.Node{
-			Type:     html.ElementNode,
-			Data:     "body",
-			DataAtom: atom.Body,
-		})
-		if err != nil {
-			t.Fatal("could not parse output HTML:", output)
-		}
+	output, err := r.Render([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
 
-		if len(outputNodes) != len(expectedNodes) {
-			t.Fatal("\ngot:\n\t", output, "\nbut expected:\n\t", c.expected)
-		}
-		for i := range outputNodes {
-			if !equal(outputNodes[i], expectedNodes[i]) {
-				t.Fatal("\ngot:\n\t", output, "\nbut expected:\n\t", c.expected)
-			}
+	expectedNodes, err := html.ParseFragment(strings.NewReader(expected), &html.Node{
+		Type:     html.ElementNode,
+		Data:     "body",
+		DataAtom: atom.Body,
+	})
+	if err != nil {
+		t.Fatal("could not parse expected HTML:", expected)
+	}
+
+	outputNodes, err := html.ParseFragment(strings.NewReader(output), &html.Node{
+		Type:     html.ElementNode,
+		Data:     "body",
+		DataAtom: atom.Body,
+	})
+	if err != nil {
+		t.Fatal("could not parse output HTML:", output)
+	}
+
+	if len(outputNodes) != len(expectedNodes) {
+		t.Fatal("\ngot:\n\t", output, "\nbut expected:\n\t", expected)
+	}
+	for i := range outputNodes {
+		if !equal(outputNodes[i], expectedNodes[i]) {
+			t.Fatal("\ngot:\n\t", output, "\nbut expected:\n\t", expected)
 		}
 	}
 }
 
+func TestFlags(t *testing.T) {
+	testcases := []struct {
+		flags    Flags
+		input    string
+		expected string
+	}{
+		{
+			flags:    Safelink,
+			input:    `{"type":"doc","content":[{"type":"paragraph","content":[{"type":"text","text":"a","marks":[{"type":"link","attrs":{"href":"javascript:alert(1)"}}]}]}]}`,
+			expected: `<p>a</p>`,
+		},
+		{
+			// protocol-relative URLs must not be treated as root-relative ("/") ones.
+			flags:    Safelink,
+			input:    `{"type":"doc","content":[{"type":"paragraph","content":[{"type":"text","text":"a","marks":[{"type":"link","attrs":{"href":"//evil.example.com/phish"}}]}]}]}`,
+			expected: `<p>a</p>`,
+		},
+		{
+			flags:    Safelink,
+			input:    `{"type":"doc","content":[{"type":"paragraph","content":[{"type":"text","text":"a","marks":[{"type":"link","attrs":{"href":"https://example.com/"}}]}]}]}`,
+			expected: `<p><a href="https://example.com/">a</a></p>`,
+		},
+		{
+			flags:    NofollowLinks | NoopenerLinks | HrefTargetBlank,
+			input:    `{"type":"doc","content":[{"type":"paragraph","content":[{"type":"text","text":"a","marks":[{"type":"link","attrs":{"href":"https://example.com/"}}]}]}]}`,
+			expected: `<p><a href="https://example.com/" rel="nofollow noopener" target="_blank">a</a></p>`,
+		},
+		{
+			flags:    SkipLinks,
+			input:    `{"type":"doc","content":[{"type":"paragraph","content":[{"type":"text","text":"a","marks":[{"type":"link","attrs":{"href":"https://example.com/"}}]}]}]}`,
+			expected: `<p>a</p>`,
+		},
+		{
+			flags:    SkipImages,
+			input:    `{"type":"doc","content":[{"type":"paragraph","content":[{"type":"image","attrs":{"src":"foo.png"}},{"type":"text","text":"a"}]}]}`,
+			expected: `<p>a</p>`,
+		},
+	}
+
+	for _, c := range testcases {
+		r := NewRendererWithFlags(c.flags)
+		assertRendersAs(t, r, c.input, c.expected)
+	}
+}
+
+func TestRenderTo(t *testing.T) {
+	r := NewRenderer()
+	input := []byte(`{"type":"doc","content":[{"type":"paragraph","content":[{"type":"text","text":"foo bar"}]}]}`)
+
+	want, err := r.Render(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := r.RenderTo(buf, input); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != want {
+		t.Fatalf("RenderTo wrote %q, want %q", buf.String(), want)
+	}
+}
+
+func TestAttributeSanitizer(t *testing.T) {
+	r := NewRenderer()
+	r.SetSanitizer(NewDefaultSanitizer())
+
+	input := `{"type":"doc","content":[{"type":"paragraph","content":[{"type":"text","text":"a","marks":[{"type":"link","attrs":{"href":"https://example.com/","onclick":"alert(1)"}}]}]}]}`
+	expected := `<p><a href="https://example.com/">a</a></p>`
+
+	assertRendersAs(t, r, input, expected)
+}
+
+type upperHighlighter struct{}
+
+func (upperHighlighter) Highlight(code, lang string) (string, error) {
+	return "<mark>" + strings.ToUpper(code) + "</mark>", nil
+}
+
+func TestCodeBlockHighlighter(t *testing.T) {
+	r := NewRenderer()
+	r.SetHighlighter(upperHighlighter{})
+
+	// Prosemirror's code_block schema is "content": "text*", like paragraph, so the text lives
+	// on a child text node, not on the code_block node itself.
+	input := `{"type":"doc","content":[{"type":"code_block","attrs":{"language":"go"},"content":[{"type":"text","text":"a b"}]}]}`
+
+	output, err := r.Render([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `<pre><code class="language-go"><mark>A B</mark></code></pre>`
+	if output != want {
+		t.Fatalf("got %q, want %q", output, want)
+	}
+}
+
+func TestSimpleTagAttrRendering(t *testing.T) {
+	tag := SimpleTag{Name: "div"}
+
+	got, err := tag.RenderOpening(map[string]interface{}{
+		"zebra": true,
+		"apple": false,
+		"count": float64(3),
+		"ratio": float64(1.5),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// attrs are sorted by name; "apple" is omitted (false bool), "count" is a whole number and
+	// renders unquoted, "ratio" has a fractional part and renders quoted, "zebra" is a true bool
+	// and renders as a bare name.
+	want := `<div count=3 ratio="1.5" zebra>`
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestHeadingAnchorsAndTOC(t *testing.T) {
+	r := NewRenderer()
+
+	input := `{"type":"doc","content":[{"type":"heading","attrs":{"level":1},"content":[{"type":"text","text":"Intro"}]},{"type":"heading","attrs":{"level":3},"content":[{"type":"text","text":"Deep Dive"}]},{"type":"heading","attrs":{"level":1},"content":[{"type":"text","text":"Intro"}]}]}`
+
+	body, toc, err := r.RenderWithTOC([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantBody := `<h1 id="intro">Intro</h1><h3 id="deep-dive">Deep Dive</h3><h1 id="intro-2">Intro</h1>`
+	if body != wantBody {
+		t.Fatalf("body = %q, want %q", body, wantBody)
+	}
+
+	wantTOC := `<nav><ul><li><a href="#intro">Intro</a><ul><li><ul><li><a href="#deep-dive">Deep Dive</a></li></ul></li></ul></li><li><a href="#intro-2">Intro</a></li></ul></nav>`
+	if toc != wantTOC {
+		t.Fatalf("toc = %q, want %q", toc, wantTOC)
+	}
+}
+
 func equal(one, two *html.Node) bool {
 	if one == nil || two == nil {
 		return one == two
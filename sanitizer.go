@@ -0,0 +1,61 @@
+package prosemirror2html
+
+// AttributeSanitizer filters or rewrites a node's or mark's attrs before they are rendered as
+// HTML by the default SimpleTag implementation. typ is the node or mark type name, e.g. "link"
+// or "image", as passed to RegisterNode/RegisterMark. Register one on a Renderer with
+// SetSanitizer.
+type AttributeSanitizer interface {
+	Sanitize(typ string, attrs map[string]interface{}) map[string]interface{}
+}
+
+// PassthroughSanitizer is an AttributeSanitizer that returns attrs unmodified. It exists so
+// callers can set it explicitly to document that attributes are intentionally left unfiltered,
+// e.g. because the Prosemirror JSON being rendered is trusted.
+type PassthroughSanitizer struct{}
+
+var _ AttributeSanitizer = PassthroughSanitizer{}
+
+// Sanitize returns attrs unmodified.
+func (PassthroughSanitizer) Sanitize(typ string, attrs map[string]interface{}) map[string]interface{} {
+	return attrs
+}
+
+// AllowlistSanitizer is an AttributeSanitizer that only lets through attributes named in Allowed
+// for a given node/mark type, dropping everything else. For types not present in Allowed,
+// Sanitize returns no attributes at all.
+type AllowlistSanitizer struct {
+	Allowed map[string][]string
+}
+
+var _ AttributeSanitizer = AllowlistSanitizer{}
+
+// NewDefaultSanitizer returns an AllowlistSanitizer with a reasonable allow-list for the node and
+// mark types NewRenderer registers by default, suitable for rendering untrusted Prosemirror JSON.
+func NewDefaultSanitizer() AllowlistSanitizer {
+	return AllowlistSanitizer{
+		Allowed: map[string][]string{
+			"link":         {"href", "title", "target", "rel"},
+			"image":        {"src", "alt", "title", "width", "height"},
+			"table_cell":   {"colspan", "rowspan", "align"},
+			"table_header": {"colspan", "rowspan", "align"},
+			"ordered_list": {"order"},
+		},
+	}
+}
+
+// Sanitize drops any attribute not allow-listed for typ.
+func (s AllowlistSanitizer) Sanitize(typ string, attrs map[string]interface{}) map[string]interface{} {
+	allowed, ok := s.Allowed[typ]
+	if !ok {
+		return nil
+	}
+
+	sanitized := make(map[string]interface{}, len(allowed))
+	for _, name := range allowed {
+		if value, ok := attrs[name]; ok {
+			sanitized[name] = value
+		}
+	}
+
+	return sanitized
+}
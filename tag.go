@@ -3,6 +3,10 @@ package prosemirror2html
 import (
 	"errors"
 	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"sort"
 )
 
 // Tag is an interface describing how a node or mark is rendered as HTML.
@@ -17,26 +21,110 @@ type Tag interface {
 	RenderClosing(attrs map[string]interface{}) (string, error)
 }
 
+// WriterTag is the streaming counterpart of Tag: instead of returning the rendered tag as a
+// string, it writes directly to an io.Writer. RegisterNode and RegisterMark still accept plain
+// Tag implementations; the Renderer wraps them in an adapter that writes the string each method
+// returns to w, so RenderTo/RenderNodeTo never join the whole output into one string. Implement
+// WriterTag (in addition to Tag) for a custom type to avoid even that per-tag string allocation.
+type WriterTag interface {
+	// RenderOpeningTo writes the type's opening tag to w. Write nothing to render no tag for your
+	// custom type.
+	RenderOpeningTo(w io.Writer, attrs map[string]interface{}) error
+	// RenderClosingTo writes the type's closing tag to w. Write nothing to render no tag for your
+	// custom type or if the tag is self-closing.
+	RenderClosingTo(w io.Writer, attrs map[string]interface{}) error
+}
+
+// TextRenderer is an optional interface for node Tag types that want to control how the node's
+// text content is rendered, instead of the default HTML-escaped text. When implemented, it takes
+// over rendering entirely for that node, receiving the concatenated text of the node itself or,
+// per Prosemirror's "content": "text*" node schemas (e.g. code_block), of its child text nodes.
+// The Renderer consults the last Tag registered for a node type; codeBlock is the only default
+// implementation using this, so it can run registered Highlighters over a code_block's text.
+type TextRenderer interface {
+	RenderText(attrs map[string]interface{}, text string) (string, error)
+}
+
+// asWriterTag adapts t to a WriterTag, using t directly if it already implements WriterTag, and
+// falling back to writing the strings returned by Tag.RenderOpening/RenderClosing otherwise.
+func asWriterTag(t Tag) WriterTag {
+	if wt, ok := t.(WriterTag); ok {
+		return wt
+	}
+	return tagWriterAdapter{t}
+}
+
+type tagWriterAdapter struct {
+	Tag
+}
+
+func (a tagWriterAdapter) RenderOpeningTo(w io.Writer, attrs map[string]interface{}) error {
+	s, err := a.Tag.RenderOpening(attrs)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, s)
+	return err
+}
+
+func (a tagWriterAdapter) RenderClosingTo(w io.Writer, attrs map[string]interface{}) error {
+	s, err := a.Tag.RenderClosing(attrs)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, s)
+	return err
+}
+
 // SimpleTag is a simple tag, using Name as tag name and rendering all attributes into the opening tag.
 // For example, the default implementation for Prosemirror's 'link' mark type is a SimpleTag, and would
 // render 'link' marks as something like `<a href="https://wikipedia.org/" target="_blank">...</a>`.
 type SimpleTag struct {
 	Name        string
 	SelfClosing bool // if true, RenderClosing returns an empty string
+
+	// r and typ are set by Renderer for the default node/mark types it registers, so their
+	// attributes can be run through r's AttributeSanitizer, if any is set. SimpleTag values
+	// constructed directly (e.g. for RegisterNode/RegisterMark) leave these at their zero value,
+	// which simply skips sanitization.
+	r   *Renderer
+	typ string
 }
 
 var _ Tag = SimpleTag{} // compile time 'implements' check
 
-// RenderOpening renders a standard HTML opening tag, with all attributes as `<name>="<value>"`.
-// If an attribute value is a number or a boolean, it will omit the surrounding quotes.
+// RenderOpening renders a standard HTML opening tag, with all attributes as `<name>="<value>"`,
+// sorted by name so output is stable across Go's randomized map iteration order.
+// Boolean attributes are rendered the HTML way: just the name when true, omitted when false.
+// Whole numbers are rendered unquoted (e.g. `level=2`); numbers with a fractional part are
+// quoted like strings. Attribute names and values are HTML-escaped.
 func (t SimpleTag) RenderOpening(attrs map[string]interface{}) (string, error) {
+	if t.r != nil && t.r.sanitizer != nil {
+		attrs = t.r.sanitizer.Sanitize(t.typ, attrs)
+	}
+
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
 	formattedAttrs := ""
-	for name, value := range attrs {
-		switch v := value.(type) {
-		case bool, float64:
-			formattedAttrs += fmt.Sprintf(` %s=%v`, name, v)
+	for _, name := range names {
+		escapedName := template.HTMLEscapeString(name)
+		switch v := attrs[name].(type) {
+		case bool:
+			if v {
+				formattedAttrs += " " + escapedName
+			}
+		case float64:
+			if v == math.Trunc(v) {
+				formattedAttrs += fmt.Sprintf(` %s=%d`, escapedName, int64(v))
+			} else {
+				formattedAttrs += fmt.Sprintf(` %s="%s"`, escapedName, template.HTMLEscapeString(fmt.Sprintf("%v", v)))
+			}
 		default:
-			formattedAttrs += fmt.Sprintf(` %s="%v"`, name, v)
+			formattedAttrs += fmt.Sprintf(` %s="%s"`, escapedName, template.HTMLEscapeString(fmt.Sprintf("%v", v)))
 		}
 	}
 
@@ -77,6 +165,11 @@ func (heading) RenderOpening(attrs map[string]interface{}) (string, error) {
 	}
 	level := int(levelFloat)
 
+	// set by Renderer when HeadingAnchors is set, or by RenderWithTOC
+	if id, ok := attrs["id"].(string); ok && id != "" {
+		return fmt.Sprintf(`<h%d id="%s">`, level, template.HTMLEscapeString(id)), nil
+	}
+
 	return fmt.Sprintf("<h%d>", level), nil
 }
 
@@ -94,3 +187,163 @@ func (heading) RenderClosing(attrs map[string]interface{}) (string, error) {
 
 	return fmt.Sprintf("</h%d>", level), nil
 }
+
+// link is the default implementation for Prosemirror's 'link' mark type. Unlike
+// SimpleTag, it consults the owning Renderer's flags to safelist the href
+// attribute and to inject rel/target attributes.
+type link struct {
+	r *Renderer
+}
+
+var _ Tag = link{} // compile time 'implements' check
+
+func (l link) RenderOpening(attrs map[string]interface{}) (string, error) {
+	if l.r.flags&SkipLinks != 0 {
+		return "", nil
+	}
+
+	attrs = l.sanitizeAttrs(attrs)
+	if l.r.flags&Safelink != 0 {
+		if href, ok := attrs["href"].(string); !ok || !isSafeURL(href) {
+			return "", nil
+		}
+	}
+
+	return SimpleTag{Name: "a", r: l.r, typ: "link"}.RenderOpening(attrs)
+}
+
+func (l link) RenderClosing(attrs map[string]interface{}) (string, error) {
+	if l.r.flags&SkipLinks != 0 {
+		return "", nil
+	}
+
+	if l.r.flags&Safelink != 0 {
+		if href, ok := attrs["href"].(string); !ok || !isSafeURL(href) {
+			return "", nil
+		}
+	}
+
+	return "</a>", nil
+}
+
+// sanitizeAttrs returns a copy of attrs with rel/target merged in according to
+// l.r.flags, leaving attrs itself (and the underlying parsed Node) untouched.
+func (l link) sanitizeAttrs(attrs map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(attrs)+2)
+	for name, value := range attrs {
+		merged[name] = value
+	}
+
+	var relTokens []string
+	if l.r.flags&NofollowLinks != 0 {
+		relTokens = append(relTokens, "nofollow")
+	}
+	if l.r.flags&NoreferrerLinks != 0 {
+		relTokens = append(relTokens, "noreferrer")
+	}
+	if l.r.flags&NoopenerLinks != 0 {
+		relTokens = append(relTokens, "noopener")
+	}
+	if len(relTokens) > 0 {
+		existingRel, _ := merged["rel"].(string)
+		merged["rel"] = mergeTokens(existingRel, relTokens...)
+	}
+
+	if l.r.flags&HrefTargetBlank != 0 {
+		if _, ok := merged["target"]; !ok {
+			merged["target"] = "_blank"
+		}
+	}
+
+	return merged
+}
+
+// image is the default implementation for Prosemirror's 'image' node type.
+// Unlike SimpleTag, it consults the owning Renderer's flags to suppress
+// rendering entirely.
+type image struct {
+	r *Renderer
+}
+
+var _ Tag = image{} // compile time 'implements' check
+
+func (i image) RenderOpening(attrs map[string]interface{}) (string, error) {
+	if i.r.flags&SkipImages != 0 {
+		return "", nil
+	}
+
+	return SimpleTag{Name: "img", SelfClosing: true, r: i.r, typ: "image"}.RenderOpening(attrs)
+}
+
+func (image) RenderClosing(map[string]interface{}) (string, error) { return "", nil }
+
+// codeBlock is the default implementation for Prosemirror's 'code_block' node type. It renders
+// as '<pre><code class="language-...">...</code></pre>' and, if the owning Renderer has a
+// Highlighter set, runs the block's text through it instead of escaping it as plain text.
+type codeBlock struct {
+	r *Renderer
+}
+
+var _ Tag = codeBlock{}
+var _ TextRenderer = codeBlock{}
+
+func (c codeBlock) RenderOpening(attrs map[string]interface{}) (string, error) {
+	lang := codeBlockLanguage(attrs)
+	if lang == "" {
+		return "<pre><code>", nil
+	}
+
+	return fmt.Sprintf(`<pre><code class="language-%s">`, template.HTMLEscapeString(lang)), nil
+}
+
+func (codeBlock) RenderClosing(map[string]interface{}) (string, error) {
+	return "</code></pre>", nil
+}
+
+// RenderText highlights text using r's Highlighter, if one is set, falling back to HTML-escaped
+// plain text otherwise.
+func (c codeBlock) RenderText(attrs map[string]interface{}, text string) (string, error) {
+	if c.r.highlighter == nil {
+		return template.HTMLEscapeString(text), nil
+	}
+
+	return c.r.highlighter.Highlight(text, codeBlockLanguage(attrs))
+}
+
+// orderedList is the default implementation for Prosemirror's 'ordered_list' node type. Unlike a
+// plain SimpleTag, it translates Prosemirror's 'order' attr into the proper HTML 'start'
+// attribute on the <ol> tag.
+type orderedList struct {
+	r *Renderer
+}
+
+var _ Tag = orderedList{}
+
+func (o orderedList) RenderOpening(attrs map[string]interface{}) (string, error) {
+	if o.r != nil && o.r.sanitizer != nil {
+		attrs = o.r.sanitizer.Sanitize("ordered_list", attrs)
+	}
+
+	order, ok := attrs["order"].(float64)
+	if !ok {
+		return "<ol>", nil
+	}
+
+	return fmt.Sprintf(`<ol start="%d">`, int64(order)), nil
+}
+
+func (orderedList) RenderClosing(map[string]interface{}) (string, error) {
+	return "</ol>", nil
+}
+
+// codeBlockLanguage reads the language a code_block node was tagged with, preferring the
+// 'language' attr and falling back to Prosemirror's legacy 'params' attr.
+func codeBlockLanguage(attrs map[string]interface{}) string {
+	if lang, ok := attrs["language"].(string); ok {
+		return lang
+	}
+	if params, ok := attrs["params"].(string); ok {
+		return params
+	}
+	return ""
+}
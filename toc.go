@@ -0,0 +1,153 @@
+package prosemirror2html
+
+import (
+	"fmt"
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+// tocEntry is one heading encountered while walking a document for table-of-contents generation.
+type tocEntry struct {
+	level int
+	id    string
+	text  string
+}
+
+// nonSlugRun matches runs of characters that are not safe to use unescaped in a URL fragment.
+var nonSlugRun = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slugify turns s into a URL-safe anchor name: lowercased, with runs of non-alphanumeric
+// characters replaced by a single '-', and leading/trailing '-' trimmed.
+func slugify(s string) string {
+	slug := nonSlugRun.ReplaceAllString(strings.ToLower(s), "-")
+	return strings.Trim(slug, "-")
+}
+
+// extractText concatenates the text of n and all of its descendants, the same text that would
+// end up inside n's rendered tag(s).
+func extractText(n *Node) string {
+	if len(n.Content) == 0 {
+		return n.Text
+	}
+
+	var b strings.Builder
+	for _, child := range n.Content {
+		b.WriteString(extractText(child))
+	}
+	return b.String()
+}
+
+// walkHeadings recursively assigns a deduplicated slug id (tracked in used) to every 'heading'
+// node under n, writing it into the node's attrs as "id". If entries is non-nil, each heading
+// encountered is also appended to it, in document order.
+func walkHeadings(n *Node, used map[string]int, entries *[]tocEntry) {
+	if n.Type == "heading" {
+		text := extractText(n)
+
+		slug := slugify(text)
+		if slug == "" {
+			slug = "section"
+		}
+		if used[slug] > 0 {
+			base := slug
+			for i := used[base] + 1; ; i++ {
+				if candidate := fmt.Sprintf("%s-%d", base, i); used[candidate] == 0 {
+					slug = candidate
+					used[base] = i
+					break
+				}
+			}
+		}
+		used[slug]++
+
+		if n.Attrs == nil {
+			n.Attrs = map[string]interface{}{}
+		}
+		n.Attrs["id"] = slug
+
+		if entries != nil {
+			level := 1
+			if lvl, ok := n.Attrs["level"].(float64); ok {
+				level = int(lvl)
+			}
+			*entries = append(*entries, tocEntry{level: level, id: slug, text: text})
+		}
+	}
+
+	for _, child := range n.Content {
+		walkHeadings(child, used, entries)
+	}
+}
+
+// tocNode is one entry in the tree used to render a nested table-of-contents <ul>. entry is nil
+// for synthetic wrappers inserted to bridge a non-monotonic level jump (e.g. h1 -> h3).
+type tocNode struct {
+	entry    *tocEntry
+	children []*tocNode
+}
+
+// buildTOCTree arranges entries, in document order, into a tree reflecting their heading levels,
+// inserting empty tocNodes to bridge any gaps so the resulting tree nests one level at a time.
+func buildTOCTree(entries []tocEntry) *tocNode {
+	root := &tocNode{}
+	if len(entries) == 0 {
+		return root
+	}
+
+	stack := []*tocNode{root}
+	levels := []int{entries[0].level - 1}
+
+	for i := range entries {
+		e := entries[i]
+
+		for len(levels) > 1 && levels[len(levels)-1] >= e.level {
+			stack = stack[:len(stack)-1]
+			levels = levels[:len(levels)-1]
+		}
+
+		parent := stack[len(stack)-1]
+		for lvl := levels[len(levels)-1] + 1; lvl < e.level; lvl++ {
+			wrapper := &tocNode{}
+			parent.children = append(parent.children, wrapper)
+			stack = append(stack, wrapper)
+			levels = append(levels, lvl)
+			parent = wrapper
+		}
+
+		node := &tocNode{entry: &e}
+		parent.children = append(parent.children, node)
+		stack = append(stack, node)
+		levels = append(levels, e.level)
+	}
+
+	return root
+}
+
+// renderTOCList renders children as a nested <ul> of <li> entries, recursing into each entry's
+// own children. It returns "" for a childless node, so empty wrapper levels don't render a
+// dangling nested <ul></ul>.
+func renderTOCList(children []*tocNode) string {
+	if len(children) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("<ul>")
+	for _, c := range children {
+		b.WriteString("<li>")
+		if c.entry != nil {
+			fmt.Fprintf(&b, `<a href="#%s">%s</a>`, template.HTMLEscapeString(c.entry.id), template.HTMLEscapeString(c.entry.text))
+		}
+		b.WriteString(renderTOCList(c.children))
+		b.WriteString("</li>")
+	}
+	b.WriteString("</ul>")
+
+	return b.String()
+}
+
+// buildTOC renders entries as a nested <nav><ul>...</ul></nav> table of contents.
+func buildTOC(entries []tocEntry) string {
+	return "<nav>" + renderTOCList(buildTOCTree(entries).children) + "</nav>"
+}